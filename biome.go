@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// valueNoise is a simple, dependency-free value-noise field: a lattice of
+// hashed pseudo-random values, smoothed with bilinear interpolation. It
+// stands in for a full Perlin/simplex implementation -- good enough to
+// partition a map into smoothly-bordered regions without pulling in
+// another package.
+type valueNoise struct {
+	seed  int64
+	scale float64
+}
+
+func newValueNoise(seed int64, scale float64) *valueNoise {
+	if scale <= 0 {
+		scale = 0.01
+	}
+
+	return &valueNoise{seed: seed, scale: scale}
+}
+
+// latticeValue hashes a lattice coordinate to a value in [0, 1).
+func (n *valueNoise) latticeValue(x, y int) float64 {
+	h := uint64(x)*374761393 + uint64(y)*668265263 + uint64(n.seed)*2246822519
+	h = (h ^ (h >> 13)) * 1274126177
+	h ^= h >> 16
+
+	return float64(h%1_000_000) / 1_000_000
+}
+
+func smoothstep(t float64) float64 { return t * t * (3 - 2*t) }
+
+func lerp(a, b, t float64) float64 { return a + (b-a)*t }
+
+// At returns a smoothly varying value in [0, 1) for the given pixel
+// coordinate.
+func (n *valueNoise) At(x, y int) float64 {
+	var (
+		fx = float64(x) * n.scale
+		fy = float64(y) * n.scale
+
+		x0, y0 = int(math.Floor(fx)), int(math.Floor(fy))
+		tx, ty = smoothstep(fx - float64(x0)), smoothstep(fy - float64(y0))
+
+		v00 = n.latticeValue(x0, y0)
+		v10 = n.latticeValue(x0+1, y0)
+		v01 = n.latticeValue(x0, y0+1)
+		v11 = n.latticeValue(x0+1, y0+1)
+	)
+
+	return lerp(lerp(v00, v10, tx), lerp(v01, v11, tx), ty)
+}
+
+// Biome groups the visual parameters that should change together across a
+// region of the map: the room shape, and the colour and width of the
+// roads passing through it.
+type Biome struct {
+	Name               string
+	RoomStyle          RoomStyle
+	RoadColour         color.Color
+	RoadWidth          float64
+	NoiseMin, NoiseMax float64
+}
+
+// BiomeMap decides which Biome applies at a given point, by feeding its
+// coordinates through a noise field and finding the biome whose
+// [NoiseMin, NoiseMax) range contains the result.
+type BiomeMap struct {
+	biomes []Biome
+	noise  *valueNoise
+}
+
+// At returns the biome that applies at pixel (x, y), or the last
+// configured biome if none of the configured ranges match.
+func (bm *BiomeMap) At(x, y int) Biome {
+	v := bm.noise.At(x, y)
+
+	for _, b := range bm.biomes {
+		if v >= b.NoiseMin && v < b.NoiseMax {
+			return b
+		}
+	}
+
+	return bm.biomes[len(bm.biomes)-1]
+}
+
+// biomeConfig is the on-disk JSON shape loaded with -biomes.
+type biomeConfig struct {
+	NoiseScale float64      `json:"noise_scale"`
+	NoiseSeed  int64        `json:"noise_seed"`
+	Biomes     []biomeEntry `json:"biomes"`
+}
+
+type biomeEntry struct {
+	Name       string  `json:"name"`
+	RoomStyle  string  `json:"room_style"`
+	RoadColour string  `json:"road_colour"`
+	RoadWidth  float64 `json:"road_width"`
+	NoiseMin   float64 `json:"noise_min"`
+	NoiseMax   float64 `json:"noise_max"`
+}
+
+// loadBiomeMap reads a JSON biome config from path and resolves it into a
+// BiomeMap, looking up each biome's room_style in the roomStyles registry.
+func loadBiomeMap(path string) (*BiomeMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg biomeConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Biomes) == 0 {
+		return nil, fmt.Errorf("biome config %q defines no biomes", path)
+	}
+
+	bm := &BiomeMap{noise: newValueNoise(cfg.NoiseSeed, cfg.NoiseScale)}
+
+	for _, e := range cfg.Biomes {
+		style, ok := roomStyles[e.RoomStyle]
+		if !ok {
+			return nil, fmt.Errorf("biome %q: unknown room_style %q", e.Name, e.RoomStyle)
+		}
+
+		colour, err := parseHexColour(e.RoadColour)
+		if err != nil {
+			return nil, fmt.Errorf("biome %q: %w", e.Name, err)
+		}
+
+		bm.biomes = append(bm.biomes, Biome{
+			Name:       e.Name,
+			RoomStyle:  style,
+			RoadColour: colour,
+			RoadWidth:  e.RoadWidth,
+			NoiseMin:   e.NoiseMin,
+			NoiseMax:   e.NoiseMax,
+		})
+	}
+
+	return bm, nil
+}
+
+// parseHexColour parses a "#RRGGBB" or "RRGGBB" string into an opaque
+// color.Color.
+func parseHexColour(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return nil, fmt.Errorf("invalid colour %q, want RRGGBB", s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid colour %q: %w", s, err)
+	}
+
+	return color.RGBA{
+		R: uint8(v >> 16),
+		G: uint8(v >> 8),
+		B: uint8(v),
+		A: 255,
+	}, nil
+}
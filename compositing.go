@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/llgcode/draw2d/draw2dimg"
+)
+
+// blendMode is how multiple seed variants of a tile are combined into one.
+type blendMode string
+
+const (
+	blendMedian blendMode = "median"
+	blendMean   blendMode = "mean"
+	blendMax    blendMode = "max"
+)
+
+// renderVariants runs the generator `seeds` times with different RNG
+// seeds, keeping only the newest tileLimit variants' tile directories (the
+// oldest is deleted right after each new one is rendered, so tileLimit+1
+// exist briefly) -- a sliding window, so "median of the newest K variants" stays
+// cheap for iterative parameter tuning -- then composites the survivors
+// tile by tile into a single "average dungeon" that smooths out any one
+// variant's unlucky layout while preserving the structure they share.
+func renderVariants(seeds, tileLimit int, mode blendMode) {
+	if tileLimit > 0 && tileLimit < seeds {
+		fmt.Printf("keeping only the newest %d of %d variants\n", tileLimit, seeds)
+	}
+
+	var variantDirs []string
+	defer func() {
+		for _, d := range variantDirs {
+			os.RemoveAll(d)
+		}
+	}()
+
+	var cols, rows int
+
+	for i := 0; i < seeds; i++ {
+		dir, err := os.MkdirTemp("", "prim-variant-")
+		if err != nil {
+			fmt.Println("couldn't create variant directory:", err)
+			return
+		}
+
+		rand.Seed(time.Now().UnixNano() + int64(i)*104729)
+
+		fmt.Printf("generating variant %d/%d... ", i+1, seeds)
+		c, r, err := renderToDir(dir)
+		if err != nil {
+			fmt.Println("failed:", err)
+			os.RemoveAll(dir)
+			continue
+		}
+		fmt.Println("done")
+
+		cols, rows = c, r
+		variantDirs = append(variantDirs, dir)
+
+		if tileLimit > 0 && len(variantDirs) > tileLimit {
+			stale := variantDirs[0]
+			variantDirs = variantDirs[1:]
+			os.RemoveAll(stale)
+		}
+	}
+
+	if len(variantDirs) == 0 {
+		fmt.Println("no variants rendered successfully")
+		return
+	}
+
+	compositeDir, err := os.MkdirTemp("", "prim-composite-")
+	if err != nil {
+		fmt.Println("couldn't create composite directory:", err)
+		return
+	}
+	defer os.RemoveAll(compositeDir)
+
+	fmt.Print("compositing tiles... ")
+	compositeTiles(variantDirs, compositeDir, cols, rows, mode)
+	fmt.Println("done")
+
+	fmt.Print("stitching tiles... ")
+	img, err := stitchTiles(compositeDir, cols, rows, *tileDivide)
+	if err != nil {
+		fmt.Println("failed:", err)
+		return
+	}
+	fmt.Println("done")
+
+	fmt.Print("generating out.png... ")
+	draw2dimg.SaveToPngFile("out.png", img)
+	fmt.Println("done")
+}
+
+// compositeTiles reads, for every tile coordinate, the same-named tile out
+// of each directory in variantDirs, blends them pixel by pixel with mode,
+// and writes the result into outDir under the same "x,y.png" name -- so
+// the existing stitchTiles can assemble it exactly like a normal render.
+// Each worker holds one tile per variant rather than whole images, and at
+// most threadCount workers run at once, so memory grows with tileSize and
+// the number of variants, not with the full output size.
+func compositeTiles(variantDirs []string, outDir string, cols, rows int, mode blendMode) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		fmt.Println("couldn't create composite directory:", err)
+		return
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, threadCount)
+	)
+
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < cols; tx++ {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(tx, ty int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				compositeTile(variantDirs, outDir, tx, ty, mode)
+			}(tx, ty)
+		}
+	}
+
+	wg.Wait()
+}
+
+// compositeTile blends the (tx, ty) tile across every variant and writes
+// the result to outDir.
+func compositeTile(variantDirs []string, outDir string, tx, ty int, mode blendMode) {
+	name := fmt.Sprintf("%d,%d.png", tx, ty)
+
+	var imgs []image.Image
+	for _, dir := range variantDirs {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	if len(imgs) == 0 {
+		return
+	}
+
+	var (
+		out = image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+		r   = make([]uint8, len(imgs))
+		g   = make([]uint8, len(imgs))
+		b   = make([]uint8, len(imgs))
+		a   = make([]uint8, len(imgs))
+	)
+
+	for y := 0; y < tileSize; y++ {
+		for x := 0; x < tileSize; x++ {
+			for i, img := range imgs {
+				cr, cg, cb, ca := img.At(x, y).RGBA()
+				r[i] = uint8(cr >> 8)
+				g[i] = uint8(cg >> 8)
+				b[i] = uint8(cb >> 8)
+				a[i] = uint8(ca >> 8)
+			}
+
+			out.Set(x, y, color.RGBA{
+				R: blendChannel(r, mode),
+				G: blendChannel(g, mode),
+				B: blendChannel(b, mode),
+				A: blendChannel(a, mode),
+			})
+		}
+	}
+
+	path := filepath.Join(outDir, name)
+	if err := draw2dimg.SaveToPngFile(path, out); err != nil {
+		fmt.Printf("couldn't save composited tile %s: %v\n", path, err)
+	}
+}
+
+// blendChannel combines one colour channel's value across every variant.
+// values is reordered in place by the median case's QuickSelect.
+func blendChannel(values []uint8, mode blendMode) uint8 {
+	switch mode {
+	case blendMean:
+		var sum int
+		for _, v := range values {
+			sum += int(v)
+		}
+
+		return uint8(sum / len(values))
+
+	case blendMax:
+		m := values[0]
+		for _, v := range values[1:] {
+			if v > m {
+				m = v
+			}
+		}
+
+		return m
+
+	default: // blendMedian
+		return quickselect(values, 0, len(values)-1, len(values)/2)
+	}
+}
+
+// quickselect finds the k-th smallest element of values, reordering it in
+// place. Unlike a full sort, this only has to partition down to the
+// target index, which keeps per-pixel median blending cheap even over
+// many variants.
+func quickselect(values []uint8, lo, hi, k int) uint8 {
+	for lo < hi {
+		p := partition(values, lo, hi)
+
+		switch {
+		case p == k:
+			return values[p]
+		case p < k:
+			lo = p + 1
+		default:
+			hi = p - 1
+		}
+	}
+
+	return values[lo]
+}
+
+func partition(values []uint8, lo, hi int) int {
+	pivot := values[hi]
+	i := lo
+
+	for j := lo; j < hi; j++ {
+		if values[j] < pivot {
+			values[i], values[j] = values[j], values[i]
+			i++
+		}
+	}
+
+	values[i], values[hi] = values[hi], values[i]
+
+	return i
+}
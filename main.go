@@ -1,17 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	_ "image/png"
 	"math"
 	"math/rand"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/llgcode/draw2d"
 	"github.com/llgcode/draw2d/draw2dimg"
-	"github.com/llgcode/draw2d/draw2dkit"
 )
 
 var (
@@ -25,12 +27,29 @@ var (
 	nodeChance                 = 0.2
 	roomProbabilityCoefficient = -1.1
 
-	roadColour = color.Black
-	roomColour = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	roadColour color.Color = color.Black
+	roomColour color.Color = color.RGBA{R: 255, G: 0, B: 0, A: 255}
 
 	threadCount = 4
 	jobs        = make(chan job, threadCount)
 	jobResults  = make(chan jobResult, threadCount)
+
+	mstAlgo = flag.String("mst", "heap", "MST algorithm to use: naive, heap, or kruskal")
+
+	roadMaskPath = flag.String("mask", "", "path to a mask image; non-white pixels mark forbidden zones that roads will route around instead of crossing")
+	tileDivide   = flag.Int("divide", 1, "downscale factor applied to the final image, for quick thumbnail overviews")
+
+	exportFormat = flag.String("export", "", "export the generated graph in this format (dot, graphml, graph6, digraph6) alongside out.png")
+	exportOut    = flag.String("out", "", "file to write the -export graph to (defaults to graph.<format>)")
+
+	importPath   = flag.String("import", "", "re-render a previously exported graph instead of generating new point positions")
+	importFormat = flag.String("import-format", "dot", "format of the graph given to -import")
+
+	biomesPath = flag.String("biomes", "", "path to a JSON biome config; each point's room style and each road's colour/width are chosen by the biome a noise field places it in")
+
+	seedCount = flag.Int("seeds", 1, "render this many independent variants and blend them into one output, smoothing out any single variant's unlucky layout")
+	blendFlag = flag.String("blend", "median", "how to combine variants when -seeds > 1: median, mean, or max")
+	tileLimit = flag.Int("tile-limit", 0, "keep only the newest N variants' tiles in the blend, for iterative parameter tuning (0 means keep all -seeds variants)")
 )
 
 // An edge represents an edge in a graph from one node to another. The nodes
@@ -55,12 +74,195 @@ type jobResult struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "stitch" {
+		stitchCmd(os.Args[2:])
+		return
+	}
+
+	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
-	spawnWorkers()
+	ensureWorkers()
 
 	render()
 }
 
+// stitchCmd implements the "stitch" subcommand: it assembles a directory of
+// previously rendered "x,y.png" tiles into a single image, without needing
+// to regenerate the map that produced them.
+func stitchCmd(args []string) {
+	fs := flag.NewFlagSet("stitch", flag.ExitOnError)
+	dir := fs.String("dir", "tiles", "directory of x,y.png tiles to stitch")
+	out := fs.String("out", "out.png", "output file for the stitched image")
+	divide := fs.Int("divide", 1, "downscale factor to apply to the stitched image, for quick thumbnail overviews")
+	fs.Parse(args)
+
+	cols, rows, err := scanTileDir(*dir)
+	if err != nil {
+		fmt.Println("couldn't scan tile directory:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("stitching %dx%d tiles from %s... ", cols, rows, *dir)
+	img, err := stitchTiles(*dir, cols, rows, *divide)
+	if err != nil {
+		fmt.Println("failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("done")
+
+	if err := draw2dimg.SaveToPngFile(*out, img); err != nil {
+		fmt.Println("couldn't save", *out+":", err)
+		os.Exit(1)
+	}
+}
+
+// loadOrGenerateGraph returns the point set and MST to render, either fresh
+// (the usual case) or decoded from *importPath, along with the Graph view
+// of whichever one was used so render can pass it straight to exportGraph.
+func loadOrGenerateGraph() ([]image.Point, [][]bool, *Graph, error) {
+	if *importPath == "" {
+		builder, err := mstBuilderFor(*mstAlgo)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		var (
+			points = generatePoints()
+			dist   = makeGraph(points)
+			mst    = builder.Build(dist)
+		)
+
+		return points, mst, newGraph(points, dist, mst), nil
+	}
+
+	f, err := os.Open(*importPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	g, err := decodeGraph(*importFormat, f)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	points, mst := g.pointsAndMST()
+
+	return points, mst, g, nil
+}
+
+// exportGraph encodes g in format and writes it to path (or to
+// "graph.<format>" if path is empty).
+func exportGraph(g *Graph, format, path string) {
+	if path == "" {
+		path = "graph." + format
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Println("couldn't create export file:", err)
+		return
+	}
+	defer f.Close()
+
+	if err := encodeGraph(g, format, f); err != nil {
+		fmt.Println("couldn't export graph:", err)
+		return
+	}
+
+	fmt.Printf("exported graph as %s to %s\n", format, path)
+}
+
+// loadBiomes loads *biomesPath into a BiomeMap, or returns nil if no config
+// was given -- in which case rendering falls back to the plain square
+// rooms and single roadColour/roadWidth it always used.
+func loadBiomes() *BiomeMap {
+	if *biomesPath == "" {
+		return nil
+	}
+
+	biomes, err := loadBiomeMap(*biomesPath)
+	if err != nil {
+		fmt.Printf("couldn't load biome config %q: %v\n", *biomesPath, err)
+		return nil
+	}
+
+	return biomes
+}
+
+// loadRoadCosts builds the cost grid roads are routed through, by applying
+// *roadMaskPath (if one was given) over a blank grid. It returns nil if no
+// mask was supplied, in which case roads fall back to straight lines.
+func loadRoadCosts() *costGrid {
+	if *roadMaskPath == "" {
+		return nil
+	}
+
+	f, err := os.Open(*roadMaskPath)
+	if err != nil {
+		fmt.Printf("couldn't open mask %q: %v\n", *roadMaskPath, err)
+		return nil
+	}
+	defer f.Close()
+
+	mask, _, err := image.Decode(f)
+	if err != nil {
+		fmt.Printf("couldn't decode mask %q: %v\n", *roadMaskPath, err)
+		return nil
+	}
+
+	costs := newCostGrid(width, height, gridSpacing)
+	costs.applyMask(mask, gridSpacing)
+
+	return costs
+}
+
+// routeEdge finds the pixel-space waypoints of the road between two points.
+// If a cost grid is supplied, the road is routed with A* so it bends
+// around anything the grid marks as expensive or forbidden; otherwise it's
+// just the straight line between the two points.
+func routeEdge(costs *costGrid, from, to image.Point) []image.Point {
+	if costs == nil {
+		return []image.Point{from, to}
+	}
+
+	fromTile := newTile(costs, from.X/gridSpacing, from.Y/gridSpacing)
+	toTile := newTile(costs, to.X/gridSpacing, to.Y/gridSpacing)
+
+	path, _, ok := astarPath(fromTile, toTile)
+
+	// toTile is only ever used by astarPath as the "to" argument for cost
+	// estimates -- it's never the pather stored under the target key in
+	// astarPath's node set, so astarPath can't release it for us.
+	releaseTile(toTile)
+
+	if !ok {
+		return []image.Point{from, to}
+	}
+
+	waypoints := make([]image.Point, len(path))
+	for i, p := range path {
+		t := p.(*tile)
+		costs.markRoad(t.x, t.y)
+		waypoints[i] = image.Point{X: t.x * gridSpacing, Y: t.y * gridSpacing}
+		releaseTile(t)
+	}
+
+	waypoints[0] = from
+	waypoints[len(waypoints)-1] = to
+
+	return waypoints
+}
+
+var spawnWorkersOnce sync.Once
+
+// ensureWorkers starts the worker pool the first time it's called and is a
+// no-op after that, so naiveMSTBuilder can depend on it being up without
+// caring whether main() or some other caller (e.g. a test) got there first.
+func ensureWorkers() {
+	spawnWorkersOnce.Do(spawnWorkers)
+}
+
 func spawnWorkers() {
 	for i := 0; i < threadCount; i++ {
 		go worker()
@@ -139,13 +341,22 @@ func aggregateJobResults() *edge {
 
 // initiateJobs takes a graph and slices it up into threadCount portions. Well,
 // not quite -- it passes the entire graph to each job, but tells each worker
-// to only work between two bounds.
+// to only work between two bounds. The columns are spread as evenly as
+// possible, with the first few jobs picking up the remainder when
+// len(graph) doesn't divide evenly by threadCount, so every column from 0 to
+// len(graph)-1 is covered by exactly one job even when there are fewer
+// columns than workers.
 func initiateJobs(graph [][]int, labelled, deleted []int) {
-	d := int(math.Floor(float64(len(graph)) / float64(threadCount)))
+	n := len(graph)
+	base := n / threadCount
+	remainder := n % threadCount
 
+	start := 0
 	for i := 0; i < threadCount; i++ {
-		start := i * d
-		end := start + d - 1
+		end := start + base - 1
+		if i < remainder {
+			end++
+		}
 
 		jobs <- job{
 			graph:    graph,
@@ -154,80 +365,95 @@ func initiateJobs(graph [][]int, labelled, deleted []int) {
 			startCol: start,
 			endCol:   end,
 		}
+
+		start = end + 1
 	}
 }
 
+// render generates a map, or -- if -seeds is more than 1 -- several
+// independent variants blended into one "average dungeon". Either way the
+// result is written to out.png.
 func render() {
-	var (
-		img = image.NewRGBA(image.Rect(0, 0, width, height))
-		gc  = draw2dimg.NewGraphicContext(img)
-
-		points = generatePoints()
-		graph  = makeGraph(points)
-		mst    = findMST(graph)
-	)
-
-	gc.BeginPath()
-	for f := 0; f < len(graph); f++ {
-		for t := 0; t < len(graph); t++ {
-			if mst[f][t] {
-				var (
-					from = points[f]
-					to   = points[t]
-				)
-
-				gc.MoveTo(float64(from.X), float64(from.Y))
-				gc.LineTo(float64(to.X), float64(to.Y))
-			}
-		}
+	if *seedCount > 1 {
+		renderVariants(*seedCount, *tileLimit, blendMode(*blendFlag))
+		return
 	}
-	gc.SetLineCap(draw2d.RoundCap)
-	gc.SetLineWidth(roadWidth)
-	gc.SetStrokeColor(roadColour)
-	gc.Close()
-	gc.Stroke()
-
-	gc.SetFillColor(roadColour)
-	for f := 0; f < len(graph); f++ {
-		for t := 0; t < len(graph); t++ {
-			if mst[f][t] {
-				var (
-					from = points[f]
-					to   = points[t]
-				)
-
-				gc.MoveTo(float64(to.X), float64(to.Y))
-				draw2dkit.Circle(gc, float64(to.X), float64(to.Y), roadWidth/2)
-				gc.Fill()
-
-				gc.MoveTo(float64(from.X), float64(from.Y))
-				draw2dkit.Circle(gc, float64(from.X), float64(from.Y), roadWidth/2)
-				gc.Fill()
-			}
-		}
+
+	tileDir, err := os.MkdirTemp("", "prim-tiles-")
+	if err != nil {
+		fmt.Println("couldn't create tile directory:", err)
+		return
 	}
+	defer os.RemoveAll(tileDir)
 
-	gc.BeginPath()
-	for p := 0; p < len(points); p++ {
-		var (
-			point = points[p]
-			conn  = numConnected(mst, p)
-		)
+	fmt.Print("rendering tiles... ")
+	cols, rows, err := renderToDir(tileDir)
+	if err != nil {
+		fmt.Println("failed:", err)
+		return
+	}
+	fmt.Println("done")
 
-		if rand.Float64() <= roomProbability(conn-1) {
-			radius := roomRadius + (rand.Float64()-0.5)*roomRadiusVariance
-			square(gc, point, radius)
-		}
+	fmt.Print("stitching tiles... ")
+	img, err := stitchTiles(tileDir, cols, rows, *tileDivide)
+	if err != nil {
+		fmt.Println("failed:", err)
+		return
 	}
-	gc.Close()
-	gc.SetFillColor(roomColour)
-	gc.Fill()
+	fmt.Println("done")
 
 	fmt.Print("generating out.png... ")
 	draw2dimg.SaveToPngFile("out.png", img)
 	fmt.Println("done")
 }
 
+// renderToDir generates a map -- a point set, its MST (optionally routed
+// around a mask and styled by biome) -- and renders it tile by tile into
+// tileDir, returning the tile grid dimensions. Going via tiles keeps
+// memory bounded at multi-thousand-pixel output sizes, since no single
+// goroutine ever holds more than one tileSize x tileSize image.NewRGBA at
+// a time.
+func renderToDir(tileDir string) (cols, rows int, err error) {
+	points, mst, g, err := loadOrGenerateGraph()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if *exportFormat != "" {
+		exportGraph(g, *exportFormat, *exportOut)
+	}
+
+	biomes := loadBiomes()
+
+	var (
+		costs = loadRoadCosts()
+		edges = mstEdges(points, mst, costs, biomes)
+	)
+
+	var (
+		roomDrawn  = make([]bool, len(points))
+		roomRadii  = make([]float64, len(points))
+		roomShapes = make([]RoomStyle, len(points))
+		roomSeeds  = make([]int64, len(points))
+	)
+
+	for p, point := range points {
+		conn := numConnected(mst, p)
+		roomDrawn[p] = rand.Float64() <= roomProbability(conn-1)
+		roomRadii[p] = roomRadius + (rand.Float64()-0.5)*roomRadiusVariance
+		roomSeeds[p] = rand.Int63()
+
+		roomShapes[p] = roomStyles["square"]
+		if biomes != nil {
+			roomShapes[p] = biomes.At(point.X, point.Y).RoomStyle
+		}
+	}
+
+	cols, rows = renderTiles(tileDir, points, mst, edges, roomDrawn, roomRadii, roomShapes, roomSeeds)
+
+	return cols, rows, nil
+}
+
 func square(gc draw2d.PathBuilder, center image.Point, radius float64) {
 	gc.MoveTo(float64(center.X)-radius, float64(center.Y)-radius)
 	gc.LineTo(float64(center.X)-radius, float64(center.Y)+radius)
@@ -281,6 +507,8 @@ func makeGraph(points []image.Point) [][]int {
 // findMST finds the minimum spanning tree in a distance matrix, giving an output
 // as an adjacency matrix.
 func findMST(graph [][]int) [][]bool {
+	ensureWorkers()
+
 	var (
 		labelled = []int{0}
 		deleted  = []int{}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Graph is the dungeon's point set and MST as a standalone, encodable
+// graph: nodes carry their pixel coordinates, edges carry the squared
+// distance makeGraph already computed for them.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// GraphNode is a single room, at its pixel coordinates.
+type GraphNode struct {
+	X, Y int
+}
+
+// GraphEdge is a single MST edge between two node indices, weighted by
+// squared distance.
+type GraphEdge struct {
+	From, To, Weight int
+}
+
+// newGraph builds a Graph from a point set, its distance matrix, and its
+// MST adjacency matrix.
+func newGraph(points []image.Point, dist [][]int, mst [][]bool) *Graph {
+	g := &Graph{Nodes: make([]GraphNode, len(points))}
+
+	for i, p := range points {
+		g.Nodes[i] = GraphNode{X: p.X, Y: p.Y}
+	}
+
+	for f := 0; f < len(mst); f++ {
+		for t := f + 1; t < len(mst); t++ {
+			if mst[f][t] {
+				g.Edges = append(g.Edges, GraphEdge{From: f, To: t, Weight: dist[f][t]})
+			}
+		}
+	}
+
+	return g
+}
+
+// pointsAndMST turns a Graph back into the point set and MST adjacency
+// matrix render expects, so a previously exported graph can be re-rendered
+// with different visual parameters without regenerating point positions.
+func (g *Graph) pointsAndMST() ([]image.Point, [][]bool) {
+	points := make([]image.Point, len(g.Nodes))
+	for i, n := range g.Nodes {
+		points[i] = image.Point{X: n.X, Y: n.Y}
+	}
+
+	mst := make([][]bool, len(points))
+	for i := range mst {
+		mst[i] = make([]bool, len(points))
+	}
+
+	for _, e := range g.Edges {
+		mst[e.From][e.To] = true
+		mst[e.To][e.From] = true
+	}
+
+	return points, mst
+}
+
+// encodeGraph writes g to w in the named format: "dot", "graphml",
+// "graph6", or "digraph6".
+func encodeGraph(g *Graph, format string, w io.Writer) error {
+	switch format {
+	case "dot":
+		return encodeDOT(g, w)
+	case "graphml":
+		return encodeGraphML(g, w)
+	case "graph6":
+		return encodeNautyFormat(g, w, false)
+	case "digraph6":
+		return encodeNautyFormat(g, w, true)
+	default:
+		return fmt.Errorf("unknown graph export format %q", format)
+	}
+}
+
+// decodeGraph decodes a graph previously written by encodeGraph. Only
+// "dot" can be decoded. graphml output also carries node coordinates but
+// has no decoder here, and graph6/digraph6 are pure topology and can never
+// carry them.
+func decodeGraph(format string, r io.Reader) (*Graph, error) {
+	switch format {
+	case "dot":
+		return decodeDOT(r)
+	default:
+		return nil, fmt.Errorf("importing format %q isn't supported: only dot can be imported", format)
+	}
+}
+
+func encodeDOT(g *Graph, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "graph dungeon {")
+	for i, n := range g.Nodes {
+		fmt.Fprintf(bw, "  %d [pos=\"%d,%d\"];\n", i, n.X, n.Y)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "  %d -- %d [weight=%d];\n", e.From, e.To, e.Weight)
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+var (
+	dotNodeRe = regexp.MustCompile(`^\s*(\d+)\s*\[pos="(-?\d+),(-?\d+)"\];?\s*$`)
+	dotEdgeRe = regexp.MustCompile(`^\s*(\d+)\s*--\s*(\d+)\s*\[weight=(-?\d+)\];?\s*$`)
+)
+
+// decodeDOT parses a graph previously written by encodeDOT. It isn't a
+// general DOT parser -- only the "pos" node attribute and "weight" edge
+// attribute this program itself emits are understood.
+func decodeDOT(r io.Reader) (*Graph, error) {
+	g := &Graph{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := dotNodeRe.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			x, _ := strconv.Atoi(m[2])
+			y, _ := strconv.Atoi(m[3])
+
+			for len(g.Nodes) <= id {
+				g.Nodes = append(g.Nodes, GraphNode{})
+			}
+			g.Nodes[id] = GraphNode{X: x, Y: y}
+			continue
+		}
+
+		if m := dotEdgeRe.FindStringSubmatch(line); m != nil {
+			from, _ := strconv.Atoi(m[1])
+			to, _ := strconv.Atoi(m[2])
+			weight, _ := strconv.Atoi(m[3])
+
+			g.Edges = append(g.Edges, GraphEdge{From: from, To: to, Weight: weight})
+		}
+	}
+
+	return g, scanner.Err()
+}
+
+func encodeGraphML(g *Graph, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(bw, `  <key id="x" for="node" attr.name="x" attr.type="int"/>`)
+	fmt.Fprintln(bw, `  <key id="y" for="node" attr.name="y" attr.type="int"/>`)
+	fmt.Fprintln(bw, `  <key id="weight" for="edge" attr.name="weight" attr.type="int"/>`)
+	fmt.Fprintln(bw, `  <graph id="dungeon" edgedefault="undirected">`)
+
+	for i, n := range g.Nodes {
+		fmt.Fprintf(bw, "    <node id=\"n%d\">\n", i)
+		fmt.Fprintf(bw, "      <data key=\"x\">%d</data>\n", n.X)
+		fmt.Fprintf(bw, "      <data key=\"y\">%d</data>\n", n.Y)
+		fmt.Fprintln(bw, "    </node>")
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "    <edge source=\"n%d\" target=\"n%d\">\n", e.From, e.To)
+		fmt.Fprintf(bw, "      <data key=\"weight\">%d</data>\n", e.Weight)
+		fmt.Fprintln(bw, "    </edge>")
+	}
+
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+
+	return bw.Flush()
+}
+
+// encodeNautyFormat implements graph6 (directed=false) and digraph6
+// (directed=true), the compact ASCII graph formats used by nauty/gonum. It
+// only supports graphs of up to 62 nodes, the single-byte N(n) case.
+// Larger graphs, which need the format's multi-byte size encoding, are
+// rejected with an error; with the default grid and nodeChance a generated
+// map has several hundred nodes, so it is rejected too.
+func encodeNautyFormat(g *Graph, w io.Writer, directed bool) error {
+	n := len(g.Nodes)
+	if n > 62 {
+		return fmt.Errorf("graph6/digraph6 export only supports up to 62 nodes, got %d", n)
+	}
+
+	adj := make([][]bool, n)
+	for i := range adj {
+		adj[i] = make([]bool, n)
+	}
+	for _, e := range g.Edges {
+		adj[e.From][e.To] = true
+		adj[e.To][e.From] = true
+	}
+
+	var bits []bool
+	if directed {
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				bits = append(bits, adj[i][j])
+			}
+		}
+	} else {
+		for j := 1; j < n; j++ {
+			for i := 0; i < j; i++ {
+				bits = append(bits, adj[i][j])
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if directed {
+		buf.WriteByte('&')
+	}
+	buf.WriteByte(byte(n + 63))
+
+	for i := 0; i < len(bits); i += 6 {
+		var b byte
+		for k := 0; k < 6; k++ {
+			b <<= 1
+			if i+k < len(bits) && bits[i+k] {
+				b |= 1
+			}
+		}
+		buf.WriteByte(b + 63)
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
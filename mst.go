@@ -0,0 +1,239 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// MSTBuilder computes a minimum spanning tree over a distance matrix graph,
+// returning the result as an adjacency matrix. Different implementations
+// trade off differently depending on how dense and how large the point set
+// is.
+type MSTBuilder interface {
+	Build(graph [][]int) [][]bool
+}
+
+// mstBuilders is the registry of selectable algorithms, looked up by the
+// -mst flag so users can pick the one best suited to their point density.
+var mstBuilders = map[string]MSTBuilder{
+	"naive":   naiveMSTBuilder{},
+	"heap":    heapMSTBuilder{},
+	"kruskal": kruskalMSTBuilder{},
+}
+
+// mstBuilderFor resolves a -mst flag value to an MSTBuilder.
+func mstBuilderFor(name string) (MSTBuilder, error) {
+	builder, ok := mstBuilders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown -mst algorithm %q (want naive, heap, or kruskal)", name)
+	}
+
+	return builder, nil
+}
+
+// naiveMSTBuilder is the original channel-backed worker-pool scan of the
+// whole distance matrix on every iteration (O(V^3)). It's kept around for
+// the benchmarks and for the rare case where a graph is small enough that
+// the overhead of a heap isn't worth paying.
+type naiveMSTBuilder struct{}
+
+func (naiveMSTBuilder) Build(graph [][]int) [][]bool {
+	return findMST(graph)
+}
+
+// heapItem is a single entry in the indexed priority queue used by
+// heapMSTBuilder: the cheapest known edge connecting node to the growing
+// tree, and the heap index it currently occupies so it can be found again
+// for a decrease-key.
+type heapItem struct {
+	node  int
+	from  int
+	dist  int
+	index int
+}
+
+// nodeHeap is a container/heap min-heap over heapItems, ordered by dist.
+type nodeHeap []*heapItem
+
+func (h nodeHeap) Len() int            { return len(h) }
+func (h nodeHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h nodeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *nodeHeap) Push(x interface{}) {
+	item := x.(*heapItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// unreachedDist marks a node that hasn't been connected to the tree yet.
+const unreachedDist = 1<<63 - 1
+
+// heapMSTBuilder finds the MST with the standard priority-queue formulation
+// of Prim's algorithm: an indexed min-heap keyed by the cheapest known edge
+// to each unlabelled node, with decrease-key performed by looking the node
+// up in nodeMap and fixing its position in the heap. This is O(E log V)
+// rather than the O(V^3) of the naive matrix scan.
+type heapMSTBuilder struct{}
+
+func (heapMSTBuilder) Build(graph [][]int) [][]bool {
+	n := len(graph)
+	output := make([][]bool, n)
+	for i := range output {
+		output[i] = make([]bool, n)
+	}
+
+	if n == 0 {
+		return output
+	}
+
+	var (
+		inTree  = make([]bool, n)
+		nodeMap = make(map[int]*heapItem, n)
+		pq      = make(nodeHeap, 0, n)
+	)
+
+	for i := 0; i < n; i++ {
+		dist := unreachedDist
+		if i == 0 {
+			dist = 0
+		}
+
+		// heap.Push (rather than a plain append + heap.Init) is what sets
+		// each item's index as it's inserted -- an item appended directly
+		// would keep its zero-value index if heapify never happened to
+		// swap it, leaving a later heap.Fix call to "fix" the wrong slot.
+		item := &heapItem{node: i, from: -1, dist: dist}
+		nodeMap[i] = item
+		heap.Push(&pq, item)
+	}
+
+	for pq.Len() > 0 {
+		item := heap.Pop(&pq).(*heapItem)
+		delete(nodeMap, item.node)
+		inTree[item.node] = true
+
+		if item.from != -1 {
+			output[item.from][item.node] = true
+			output[item.node][item.from] = true
+		}
+
+		for t := 0; t < n; t++ {
+			if inTree[t] || t == item.node {
+				continue
+			}
+
+			next, ok := nodeMap[t]
+			if !ok {
+				continue
+			}
+
+			dist := graph[item.node][t]
+			if dist >= 0 && dist < next.dist {
+				next.dist = dist
+				next.from = item.node
+				heap.Fix(&pq, next.index)
+			}
+		}
+	}
+
+	return output
+}
+
+// kruskalMSTBuilder finds the MST by sorting every edge by weight and
+// adding each one that doesn't close a cycle, tracked with a union-find
+// structure over the node set. Sorting the edge list makes this a good fit
+// for sparse graphs, at the cost of materialising every edge up front.
+type kruskalMSTBuilder struct{}
+
+func (kruskalMSTBuilder) Build(graph [][]int) [][]bool {
+	n := len(graph)
+	output := make([][]bool, n)
+	for i := range output {
+		output[i] = make([]bool, n)
+	}
+
+	edges := make([]edge, 0, n*n/2)
+	for f := 0; f < n; f++ {
+		for t := f + 1; t < n; t++ {
+			if graph[f][t] >= 0 {
+				edges = append(edges, edge{from: f, to: t})
+			}
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return graph[edges[i].from][edges[i].to] < graph[edges[j].from][edges[j].to]
+	})
+
+	uf := newUnionFind(n)
+	for _, e := range edges {
+		if uf.find(e.from) == uf.find(e.to) {
+			continue
+		}
+
+		uf.union(e.from, e.to)
+		output[e.from][e.to] = true
+		output[e.to][e.from] = true
+	}
+
+	return output
+}
+
+// unionFind is a disjoint-set structure with path compression and union by
+// rank, used by kruskalMSTBuilder to detect cycles in amortised O(1) per
+// edge.
+type unionFind struct {
+	parent, rank []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{
+		parent: make([]int, n),
+		rank:   make([]int, n),
+	}
+
+	for i := range uf.parent {
+		uf.parent[i] = i
+	}
+
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	if uf.parent[i] != i {
+		uf.parent[i] = uf.find(uf.parent[i])
+	}
+
+	return uf.parent[i]
+}
+
+func (uf *unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra == rb {
+		return
+	}
+
+	if uf.rank[ra] < uf.rank[rb] {
+		ra, rb = rb, ra
+	}
+
+	uf.parent[rb] = ra
+	if uf.rank[ra] == uf.rank[rb] {
+		uf.rank[ra]++
+	}
+}
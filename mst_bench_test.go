@@ -0,0 +1,44 @@
+package main
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// benchPoints returns n points scattered over a 4096x4096 area, seeded
+// deterministically so the three builders are compared on the same graph.
+func benchPoints(n int) []image.Point {
+	r := rand.New(rand.NewSource(42))
+	points := make([]image.Point, n)
+
+	for i := range points {
+		points[i] = image.Point{
+			X: r.Intn(4096),
+			Y: r.Intn(4096),
+		}
+	}
+
+	return points
+}
+
+func benchmarkMSTBuilder(b *testing.B, builder MSTBuilder, n int) {
+	graph := makeGraph(benchPoints(n))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder.Build(graph)
+	}
+}
+
+func BenchmarkNaiveMST500(b *testing.B)   { benchmarkMSTBuilder(b, naiveMSTBuilder{}, 500) }
+func BenchmarkHeapMST500(b *testing.B)    { benchmarkMSTBuilder(b, heapMSTBuilder{}, 500) }
+func BenchmarkKruskalMST500(b *testing.B) { benchmarkMSTBuilder(b, kruskalMSTBuilder{}, 500) }
+
+func BenchmarkNaiveMST2000(b *testing.B)   { benchmarkMSTBuilder(b, naiveMSTBuilder{}, 2000) }
+func BenchmarkHeapMST2000(b *testing.B)    { benchmarkMSTBuilder(b, heapMSTBuilder{}, 2000) }
+func BenchmarkKruskalMST2000(b *testing.B) { benchmarkMSTBuilder(b, kruskalMSTBuilder{}, 2000) }
+
+func BenchmarkNaiveMST10000(b *testing.B)   { benchmarkMSTBuilder(b, naiveMSTBuilder{}, 10000) }
+func BenchmarkHeapMST10000(b *testing.B)    { benchmarkMSTBuilder(b, heapMSTBuilder{}, 10000) }
+func BenchmarkKruskalMST10000(b *testing.B) { benchmarkMSTBuilder(b, kruskalMSTBuilder{}, 10000) }
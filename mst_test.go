@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// mstWeight sums the distance-matrix weight of every edge marked in an MST
+// adjacency matrix.
+func mstWeight(dist [][]int, mst [][]bool) int {
+	total := 0
+
+	for f := 0; f < len(mst); f++ {
+		for t := f + 1; t < len(mst); t++ {
+			if mst[f][t] {
+				total += dist[f][t]
+			}
+		}
+	}
+
+	return total
+}
+
+// mstEdgeCount counts the edges marked in an MST adjacency matrix.
+func mstEdgeCount(mst [][]bool) int {
+	count := 0
+
+	for f := 0; f < len(mst); f++ {
+		for t := f + 1; t < len(mst); t++ {
+			if mst[f][t] {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// TestMSTBuildersAgree checks that every registered MSTBuilder produces a
+// spanning tree (n-1 edges) of the same total weight as the others, on the
+// same graph. With three independently-implemented algorithms this is the
+// one test that would catch a divergence between them.
+func TestMSTBuildersAgree(t *testing.T) {
+	for _, n := range []int{2, 3, 10, 100} {
+		dist := makeGraph(benchPoints(n))
+		want := mstWeight(dist, naiveMSTBuilder{}.Build(dist))
+
+		for name, builder := range mstBuilders {
+			mst := builder.Build(dist)
+
+			if got := mstEdgeCount(mst); got != n-1 {
+				t.Errorf("n=%d: %s built %d edges, want %d", n, name, got, n-1)
+			}
+
+			if got := mstWeight(dist, mst); got != want {
+				t.Errorf("n=%d: %s total weight %d, want %d (naive)", n, name, got, want)
+			}
+		}
+	}
+}
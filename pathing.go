@@ -0,0 +1,287 @@
+package main
+
+import (
+	"container/heap"
+	"image"
+	"math"
+	"sync"
+)
+
+// Pather is anything that can be routed between with A*: it knows its
+// neighbours, the cost of stepping to one of them, and a lower bound on the
+// cost to a destination.
+type Pather interface {
+	PathNeighbors() []Pather
+	PathNeighborCost(to Pather) float64
+	PathEstimatedCost(to Pather) float64
+}
+
+// pathKeyer lets a Pather identify itself with a comparable key distinct
+// from pointer identity. This matters here because tiles are handed out of
+// a sync.Pool, so two Pathers at the same coordinate aren't necessarily the
+// same pointer.
+type pathKeyer interface {
+	PathKey() interface{}
+}
+
+func pathKeyOf(p Pather) interface{} {
+	if k, ok := p.(pathKeyer); ok {
+		return k.PathKey()
+	}
+
+	return p
+}
+
+// costGrid is a grid of per-cell movement costs that roads are routed
+// through. A cell's cost is costOpen for open ground, costRoad for ground
+// that already carries a road (discouraged but not forbidden, to keep
+// roads from bunching up), and costForbidden for anything a mask image
+// marks as off-limits -- water, terrain, or a user-supplied exclusion zone.
+type costGrid struct {
+	cells [][]float64
+	w, h  int
+}
+
+const (
+	costOpen      = 1.0
+	costRoad      = 8.0
+	costForbidden = math.MaxFloat64
+)
+
+// newCostGrid builds a cost grid with cellSize pixels per cell, covering a
+// width x height image, with every cell starting at costOpen.
+func newCostGrid(width, height, cellSize int) *costGrid {
+	w := width/cellSize + 1
+	h := height/cellSize + 1
+
+	g := &costGrid{
+		cells: make([][]float64, h),
+		w:     w,
+		h:     h,
+	}
+
+	for y := range g.cells {
+		g.cells[y] = make([]float64, w)
+		for x := range g.cells[y] {
+			g.cells[y][x] = costOpen
+		}
+	}
+
+	return g
+}
+
+// applyMask raises the cost of every cell whose corresponding mask pixel
+// isn't white to costForbidden, so A* routes around whatever the mask
+// marks as off-limits.
+func (g *costGrid) applyMask(mask image.Image, cellSize int) {
+	bounds := mask.Bounds()
+
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			px := bounds.Min.X + x*cellSize
+			py := bounds.Min.Y + y*cellSize
+
+			if px >= bounds.Max.X || py >= bounds.Max.Y {
+				continue
+			}
+
+			r, gr, b, _ := mask.At(px, py).RGBA()
+			if r < 0xffff || gr < 0xffff || b < 0xffff {
+				g.cells[y][x] = costForbidden
+			}
+		}
+	}
+}
+
+// markRoad marks a cell as already carrying a road, discouraging (but not
+// forbidding) later paths from running alongside it.
+func (g *costGrid) markRoad(x, y int) {
+	if y < 0 || y >= g.h || x < 0 || x >= g.w {
+		return
+	}
+
+	if g.cells[y][x] == costOpen {
+		g.cells[y][x] = costRoad
+	}
+}
+
+// tilePool recycles *tile values between PathNeighbors calls, since A* over
+// a large grid would otherwise allocate four new tiles per expanded node.
+var tilePool = sync.Pool{
+	New: func() interface{} { return new(tile) },
+}
+
+// tile is a single cell in a costGrid, and implements Pather by looking at
+// its four orthogonal neighbours.
+type tile struct {
+	grid *costGrid
+	x, y int
+}
+
+func newTile(grid *costGrid, x, y int) *tile {
+	t := tilePool.Get().(*tile)
+	t.grid = grid
+	t.x = x
+	t.y = y
+	return t
+}
+
+// releaseTile returns a tile to tilePool once a path that referenced it is
+// no longer needed.
+func releaseTile(p Pather) {
+	if t, ok := p.(*tile); ok {
+		tilePool.Put(t)
+	}
+}
+
+func (t *tile) PathKey() interface{} { return [2]int{t.x, t.y} }
+
+func (t *tile) PathNeighbors() []Pather {
+	var neighbors []Pather
+
+	for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		nx, ny := t.x+d[0], t.y+d[1]
+		if nx < 0 || nx >= t.grid.w || ny < 0 || ny >= t.grid.h {
+			continue
+		}
+
+		if t.grid.cells[ny][nx] == costForbidden {
+			continue
+		}
+
+		neighbors = append(neighbors, newTile(t.grid, nx, ny))
+	}
+
+	return neighbors
+}
+
+func (t *tile) PathNeighborCost(to Pather) float64 {
+	n := to.(*tile)
+	return t.grid.cells[n.y][n.x]
+}
+
+func (t *tile) PathEstimatedCost(to Pather) float64 {
+	n := to.(*tile)
+	dx := float64(t.x - n.x)
+	dy := float64(t.y - n.y)
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// pathNode is an entry in the A* open/closed set: a candidate Pather
+// together with the best cost found so far to reach it, and its position
+// in the priority queue.
+type pathNode struct {
+	pather Pather
+	parent *pathNode
+	cost   float64
+	rank   float64
+	open   bool
+	closed bool
+	index  int
+}
+
+type nodeQueue []*pathNode
+
+func (q nodeQueue) Len() int           { return len(q) }
+func (q nodeQueue) Less(i, j int) bool { return q[i].rank < q[j].rank }
+func (q nodeQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *nodeQueue) Push(x interface{}) {
+	n := x.(*pathNode)
+	n.index = len(*q)
+	*q = append(*q, n)
+}
+
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	node.index = -1
+	*q = old[:n-1]
+	return node
+}
+
+// astarPath finds the lowest cost path from `from` to `to`, returning the
+// path in order from start to destination along with its total cost. ok is
+// false if no path exists.
+func astarPath(from, to Pather) (path []Pather, cost float64, ok bool) {
+	nodes := map[interface{}]*pathNode{}
+	targetKey := pathKeyOf(to)
+
+	nodeFor := func(p Pather) *pathNode {
+		key := pathKeyOf(p)
+		if n, found := nodes[key]; found {
+			// A tile can be reached as a neighbor from more than one
+			// direction; p is a fresh tile newTile just allocated for this
+			// visit, but the cell is already tracked under an earlier one,
+			// so p itself is never going to be referenced again.
+			releaseTile(p)
+			return n
+		}
+
+		n := &pathNode{pather: p, index: -1}
+		nodes[key] = n
+		return n
+	}
+
+	fromNode := nodeFor(from)
+	fromNode.open = true
+	fromNode.rank = from.PathEstimatedCost(to)
+
+	pq := &nodeQueue{fromNode}
+	heap.Init(pq)
+
+	for pq.Len() > 0 {
+		current := heap.Pop(pq).(*pathNode)
+		current.open = false
+		current.closed = true
+
+		if pathKeyOf(current.pather) == targetKey {
+			onPath := map[interface{}]bool{}
+			for n := current; n != nil; n = n.parent {
+				path = append([]Pather{n.pather}, path...)
+				onPath[pathKeyOf(n.pather)] = true
+			}
+
+			for key, n := range nodes {
+				if !onPath[key] {
+					releaseTile(n.pather)
+				}
+			}
+
+			return path, current.cost, true
+		}
+
+		for _, neighbor := range current.pather.PathNeighbors() {
+			neighborNode := nodeFor(neighbor)
+			if neighborNode.closed {
+				continue
+			}
+
+			stepCost := current.cost + current.pather.PathNeighborCost(neighbor)
+			if !neighborNode.open || stepCost < neighborNode.cost {
+				neighborNode.open = true
+				neighborNode.cost = stepCost
+				neighborNode.parent = current
+				neighborNode.rank = stepCost + neighbor.PathEstimatedCost(to)
+
+				if neighborNode.index >= 0 {
+					heap.Fix(pq, neighborNode.index)
+				} else {
+					heap.Push(pq, neighborNode)
+				}
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		releaseTile(n.pather)
+	}
+
+	return nil, 0, false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"image"
+	"math"
+	"math/rand"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dkit"
+)
+
+// RoomStyle draws a single room centered at a point. connectivity is the
+// room's degree in the MST, and rng is a dedicated random source so a
+// style can vary its shape without disturbing the rest of the generator's
+// random sequence.
+type RoomStyle interface {
+	Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand)
+}
+
+// roomStyles is the registry of built-in room shapes, looked up by name
+// from biome configuration files.
+var roomStyles = map[string]RoomStyle{
+	"square":    squareRoomStyle{},
+	"circle":    circleRoomStyle{},
+	"hex":       hexRoomStyle{},
+	"star":      starRoomStyle{},
+	"irregular": irregularRoomStyle{},
+}
+
+// squareRoomStyle is the original, hard-coded room shape.
+type squareRoomStyle struct{}
+
+func (squareRoomStyle) Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand) {
+	square(gc, center, radius)
+}
+
+type circleRoomStyle struct{}
+
+func (circleRoomStyle) Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand) {
+	draw2dkit.Circle(gc, float64(center.X), float64(center.Y), radius)
+}
+
+type hexRoomStyle struct{}
+
+func (hexRoomStyle) Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand) {
+	regularPolygon(gc, center, radius, 6)
+}
+
+type starRoomStyle struct{}
+
+func (starRoomStyle) Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand) {
+	star(gc, center, radius, 5)
+}
+
+// irregularRoomStyle perturbs each vertex of an octagon by a random
+// fraction of the radius, so every room of this style comes out a
+// slightly different shape.
+type irregularRoomStyle struct{}
+
+func (irregularRoomStyle) Draw(gc draw2d.GraphicContext, center image.Point, radius float64, connectivity int, rng *rand.Rand) {
+	const sides = 8
+
+	for i := 0; i < sides; i++ {
+		angle := 2 * math.Pi * float64(i) / sides
+		r := radius * (0.7 + 0.6*rng.Float64())
+		x := float64(center.X) + r*math.Cos(angle)
+		y := float64(center.Y) + r*math.Sin(angle)
+
+		if i == 0 {
+			gc.MoveTo(x, y)
+		} else {
+			gc.LineTo(x, y)
+		}
+	}
+}
+
+// regularPolygon draws a regular polygon with the given number of sides,
+// centered at center.
+func regularPolygon(gc draw2d.GraphicContext, center image.Point, radius float64, sides int) {
+	for i := 0; i < sides; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(sides)
+		x := float64(center.X) + radius*math.Cos(angle)
+		y := float64(center.Y) + radius*math.Sin(angle)
+
+		if i == 0 {
+			gc.MoveTo(x, y)
+		} else {
+			gc.LineTo(x, y)
+		}
+	}
+}
+
+// star draws a star by alternating between radius and a smaller inner
+// radius around the given number of points.
+func star(gc draw2d.GraphicContext, center image.Point, radius float64, points int) {
+	inner := radius * 0.5
+
+	for i := 0; i < points*2; i++ {
+		r := radius
+		if i%2 == 1 {
+			r = inner
+		}
+
+		angle := math.Pi * float64(i) / float64(points)
+		x := float64(center.X) + r*math.Sin(angle)
+		y := float64(center.Y) - r*math.Cos(angle)
+
+		if i == 0 {
+			gc.MoveTo(x, y)
+		} else {
+			gc.LineTo(x, y)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"github.com/llgcode/draw2d/draw2dkit"
+)
+
+// tileSize is the edge length, in pixels, of each tile the output image is
+// divided into before rendering.
+const tileSize = 512
+
+// roomOvershoot is the largest factor by which any RoomStyle's drawn
+// geometry can exceed its nominal radius -- irregularRoomStyle perturbs
+// vertices out to 1.3x radius, and every other style stays within radius.
+const roomOvershoot = 1.3
+
+// roadEdge is an MST edge that's already been routed to its final
+// pixel-space waypoints, so every tile worker can reuse the same geometry
+// instead of re-running A* once per tile it happens to cross. Colour and
+// Width are taken from the biome at the edge's "from" point, so a single
+// map can have e.g. wide black roads through a castle biome and narrow
+// green paths through a forest one.
+type roadEdge struct {
+	waypoints []image.Point
+	colour    color.Color
+	width     float64
+}
+
+// mstEdges routes every edge in mst exactly once (as f < t) and returns the
+// resulting waypoints. biomes may be nil, in which case every edge uses the
+// default roadColour and roadWidth.
+func mstEdges(points []image.Point, mst [][]bool, costs *costGrid, biomes *BiomeMap) []roadEdge {
+	var edges []roadEdge
+
+	for f := 0; f < len(mst); f++ {
+		for t := f + 1; t < len(mst); t++ {
+			if mst[f][t] {
+				colour, width := roadColour, roadWidth
+				if biomes != nil {
+					b := biomes.At(points[f].X, points[f].Y)
+					colour, width = b.RoadColour, b.RoadWidth
+				}
+
+				edges = append(edges, roadEdge{
+					waypoints: routeEdge(costs, points[f], points[t]),
+					colour:    colour,
+					width:     width,
+				})
+			}
+		}
+	}
+
+	return edges
+}
+
+// tileBounds returns the pixel rectangle covered by tile (tx, ty).
+func tileBounds(tx, ty int) image.Rectangle {
+	return image.Rect(tx*tileSize, ty*tileSize, (tx+1)*tileSize, (ty+1)*tileSize)
+}
+
+// segmentHitsTile reports whether the line from a to b, padded by margin,
+// could touch tile's bounds.
+func segmentHitsTile(tile image.Rectangle, a, b image.Point, margin int) bool {
+	bounds := image.Rect(
+		minInt(a.X, b.X)-margin, minInt(a.Y, b.Y)-margin,
+		maxInt(a.X, b.X)+margin, maxInt(a.Y, b.Y)+margin,
+	)
+
+	return bounds.Overlaps(tile)
+}
+
+// pointHitsTile reports whether a circle of the given radius around p
+// could touch tile's bounds.
+func pointHitsTile(tile image.Rectangle, p image.Point, radius int) bool {
+	bounds := image.Rect(p.X-radius, p.Y-radius, p.X+radius, p.Y+radius)
+	return bounds.Overlaps(tile)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// renderTiles divides the output into tileSize x tileSize tiles and renders
+// each one in its own worker. Every tile tests every edge segment and room
+// with segmentHitsTile/pointHitsTile and draws only those whose padded
+// bounding box overlaps it; there is no spatial index, so each tile still
+// scans the full edge and room lists. Each tile is written to tileDir as
+// "x,y.png". It returns the tile grid dimensions.
+func renderTiles(tileDir string, points []image.Point, mst [][]bool, edges []roadEdge, roomDrawn []bool, roomRadii []float64, roomShapes []RoomStyle, roomSeeds []int64) (cols, rows int) {
+	cols = (width + tileSize - 1) / tileSize
+	rows = (height + tileSize - 1) / tileSize
+
+	if err := os.MkdirAll(tileDir, 0755); err != nil {
+		fmt.Println("couldn't create tile directory:", err)
+		return cols, rows
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, threadCount)
+	)
+
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < cols; tx++ {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(tx, ty int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				renderTile(tileDir, tx, ty, points, mst, edges, roomDrawn, roomRadii, roomShapes, roomSeeds)
+			}(tx, ty)
+		}
+	}
+
+	wg.Wait()
+
+	return cols, rows
+}
+
+// renderTile renders the single tile at (tx, ty) and saves it to
+// "tx,ty.png" inside tileDir.
+func renderTile(tileDir string, tx, ty int, points []image.Point, mst [][]bool, edges []roadEdge, roomDrawn []bool, roomRadii []float64, roomShapes []RoomStyle, roomSeeds []int64) {
+	var (
+		bounds = tileBounds(tx, ty)
+		origin = bounds.Min
+		img    = image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+		gc     = draw2dimg.NewGraphicContext(img)
+	)
+
+	gc.SetLineCap(draw2d.RoundCap)
+
+	for _, e := range edges {
+		gc.BeginPath()
+
+		// Each edge is drawn at its own (possibly biome-specific) width, so
+		// the margin used to decide whether it crosses into this tile has
+		// to be derived from e.width rather than the global roadWidth --
+		// otherwise a wide biome road can visibly extend into a tile that
+		// the bounding-box check skipped.
+		margin := int(e.width)
+
+		drew := false
+		for i := 0; i < len(e.waypoints)-1; i++ {
+			a, b := e.waypoints[i], e.waypoints[i+1]
+			if !segmentHitsTile(bounds, a, b, margin) {
+				continue
+			}
+
+			gc.MoveTo(float64(a.X-origin.X), float64(a.Y-origin.Y))
+			gc.LineTo(float64(b.X-origin.X), float64(b.Y-origin.Y))
+			drew = true
+		}
+
+		if !drew {
+			continue
+		}
+
+		gc.SetLineWidth(e.width)
+		gc.SetStrokeColor(e.colour)
+		gc.Close()
+		gc.Stroke()
+
+		gc.SetFillColor(e.colour)
+		ends := []image.Point{e.waypoints[0], e.waypoints[len(e.waypoints)-1]}
+		for _, p := range ends {
+			if !pointHitsTile(bounds, p, margin) {
+				continue
+			}
+
+			local := image.Point{X: p.X - origin.X, Y: p.Y - origin.Y}
+			gc.MoveTo(float64(local.X), float64(local.Y))
+			draw2dkit.Circle(gc, float64(local.X), float64(local.Y), e.width/2)
+			gc.Fill()
+		}
+	}
+
+	gc.SetFillColor(roomColour)
+	for p, point := range points {
+		// irregularRoomStyle can perturb a vertex out to roomOvershoot times
+		// the nominal radius, so the margin has to account for that rather
+		// than just the radius itself, or a wide irregular room near a tile
+		// boundary would get clipped.
+		margin := int(roomRadii[p] * roomOvershoot)
+
+		if !roomDrawn[p] || !pointHitsTile(bounds, point, margin) {
+			continue
+		}
+
+		local := image.Point{X: point.X - origin.X, Y: point.Y - origin.Y}
+
+		// Each tile that overlaps a room's margin draws it independently in
+		// its own goroutine, so the RNG a RoomStyle uses has to be created
+		// here rather than shared across tiles -- rand.Rand isn't safe for
+		// concurrent use.
+		rng := rand.New(rand.NewSource(roomSeeds[p]))
+
+		gc.BeginPath()
+		roomShapes[p].Draw(gc, local, roomRadii[p], numConnected(mst, p), rng)
+		gc.Close()
+		gc.Fill()
+	}
+
+	path := filepath.Join(tileDir, fmt.Sprintf("%d,%d.png", tx, ty))
+	if err := draw2dimg.SaveToPngFile(path, img); err != nil {
+		fmt.Printf("couldn't save tile %s: %v\n", path, err)
+	}
+}
+
+var tileNameRe = regexp.MustCompile(`^(\d+),(\d+)\.png$`)
+
+// scanTileDir finds the tile grid dimensions already rendered into dir, by
+// looking at the largest x,y.png filenames present.
+func scanTileDir(dir string) (cols, rows int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, e := range entries {
+		m := tileNameRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+
+		if x+1 > cols {
+			cols = x + 1
+		}
+		if y+1 > rows {
+			rows = y + 1
+		}
+	}
+
+	return cols, rows, nil
+}
+
+// stitchTiles assembles the cols x rows grid of tileSize tiles in dir into
+// a single image, downscaling by divide (1 means no downscale) with simple
+// box averaging. Each tile is decoded and composited under its own mutex
+// lock on the destination image, so tiles can be read and decoded in
+// parallel while only the actual compositing is serialised.
+func stitchTiles(dir string, cols, rows, divide int) (image.Image, error) {
+	if divide < 1 {
+		divide = 1
+	}
+
+	var (
+		full = image.NewRGBA(image.Rect(0, 0, cols*tileSize, rows*tileSize))
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, threadCount)
+
+		firstErr error
+	)
+
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < cols; tx++ {
+			wg.Add(1)
+			sem <- struct{}{}
+
+			go func(tx, ty int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				path := filepath.Join(dir, fmt.Sprintf("%d,%d.png", tx, ty))
+
+				f, err := os.Open(path)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+				defer f.Close()
+
+				tileImg, _, err := image.Decode(f)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+
+				origin := image.Point{X: tx * tileSize, Y: ty * tileSize}
+				rect := image.Rect(origin.X, origin.Y, origin.X+tileSize, origin.Y+tileSize)
+
+				mu.Lock()
+				draw.Draw(full, rect, tileImg, image.Point{}, draw.Src)
+				mu.Unlock()
+			}(tx, ty)
+		}
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if divide == 1 {
+		return full, nil
+	}
+
+	return downscale(full, divide), nil
+}
+
+// downscale shrinks img by an integer factor, averaging each factor x
+// factor block of source pixels into one destination pixel.
+func downscale(img image.Image, factor int) image.Image {
+	var (
+		bounds = img.Bounds()
+		w, h   = bounds.Dx() / factor, bounds.Dy() / factor
+		out    = image.NewRGBA(image.Rect(0, 0, w, h))
+	)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b, a, n uint64
+
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					sr, sg, sb, sa := img.At(bounds.Min.X+x*factor+dx, bounds.Min.Y+y*factor+dy).RGBA()
+					r += uint64(sr)
+					g += uint64(sg)
+					b += uint64(sb)
+					a += uint64(sa)
+					n++
+				}
+			}
+
+			out.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return out
+}